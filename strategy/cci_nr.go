@@ -0,0 +1,218 @@
+// Package strategy 包含内置的可运行交易策略
+package strategy
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/dcbax/nofx/trader"
+)
+
+// Config 是 CCINR 策略的配置
+type Config struct {
+	Symbols     []string // 交易标的，如 ["BTCUSDT", "ETHUSDT"]
+	Interval    string   // K线周期，如 "1m"/"5m"
+	CCIWindow   int      // CCI 计算窗口
+	LongCCI     float64  // CCI 低于该值视为超卖，触发做多（如 -150）
+	ShortCCI    float64  // CCI 高于该值视为超买，触发做空（如 150）
+	NRCount     int      // NR-k 窗口，默认 4（NR4）
+	Amount      float64  // 每次开仓数量（标的计价，非张数）
+	Leverage    int
+	ProfitRange float64 // 止盈幅度，如 0.02 代表 2%
+	LossRange   float64 // 止损幅度
+	StrictMode  bool    // 严格模式：要求 NR bar 收盘价突破前一根K线的区间
+	DryRun      bool    // 只打印信号，不实际下单
+}
+
+// CCINR 是 CCI + Narrow Range(NR-k) 组合策略：
+// 当 CCI 进入超买/超卖区间，且当前K线是最近 NRCount 根里波幅最窄的一根（NR-k信号）时入场
+type CCINR struct {
+	cfg Config
+	ex  trader.Exchange
+}
+
+// NewCCINR 创建一个 CCINR 策略实例
+func NewCCINR(ex trader.Exchange, cfg Config) *CCINR {
+	return &CCINR{cfg: cfg, ex: ex}
+}
+
+// Run 对配置中的每个 symbol 拉取最新K线并按信号开仓
+func (s *CCINR) Run() error {
+	for _, symbol := range s.cfg.Symbols {
+		if err := s.runSymbol(symbol); err != nil {
+			log.Printf("⚠ CCINR 策略处理 %s 失败: %v", symbol, err)
+		}
+	}
+	return nil
+}
+
+func (s *CCINR) runSymbol(symbol string) error {
+	limit := s.cfg.CCIWindow + s.cfg.NRCount + 2
+	klines, err := s.ex.GetKline(symbol, s.cfg.Interval, limit)
+	if err != nil {
+		return fmt.Errorf("获取 %s K线失败: %w", symbol, err)
+	}
+
+	signal, err := s.evaluate(klines)
+	if err != nil {
+		return err
+	}
+	if signal == "" {
+		return nil
+	}
+
+	last := klines[len(klines)-1]
+	log.Printf("📡 CCINR 信号: %s %s, 入场价: %f", symbol, signal, last.Close)
+
+	if s.cfg.DryRun {
+		log.Printf("  (DryRun) 跳过实际下单")
+		return nil
+	}
+
+	switch signal {
+	case "long":
+		return s.enter(symbol, "long", last.Close)
+	case "short":
+		return s.enter(symbol, "short", last.Close)
+	}
+	return nil
+}
+
+func (s *CCINR) enter(symbol, side string, entry float64) error {
+	var err error
+	if side == "long" {
+		_, err = s.ex.OpenLong(symbol, s.cfg.Amount, s.cfg.Leverage)
+	} else {
+		_, err = s.ex.OpenShort(symbol, s.cfg.Amount, s.cfg.Leverage)
+	}
+	if err != nil {
+		return fmt.Errorf("%s 开%s仓失败: %w", symbol, side, err)
+	}
+
+	stopLoss := entry * (1 - s.cfg.LossRange)
+	takeProfit := entry * (1 + s.cfg.ProfitRange)
+	if side == "short" {
+		stopLoss = entry * (1 + s.cfg.LossRange)
+		takeProfit = entry * (1 - s.cfg.ProfitRange)
+	}
+
+	if err := s.ex.SetStopLoss(symbol, side, s.cfg.Amount, stopLoss); err != nil {
+		return fmt.Errorf("%s 设置止损失败: %w", symbol, err)
+	}
+	if err := s.ex.SetTakeProfit(symbol, side, s.cfg.Amount, takeProfit); err != nil {
+		return fmt.Errorf("%s 设置止盈失败: %w", symbol, err)
+	}
+	return nil
+}
+
+// evaluate 根据最新的K线序列计算 CCI + NR-k 信号，返回 "long"/"short"/""
+func (s *CCINR) evaluate(klines []trader.Kline) (string, error) {
+	window := s.cfg.CCIWindow
+	nrCount := s.cfg.NRCount
+	if nrCount <= 0 {
+		nrCount = 4
+	}
+
+	need := window + 1
+	if nrCount+1 > need {
+		need = nrCount + 1
+	}
+	if len(klines) < need {
+		return "", fmt.Errorf("K线数量不足，无法计算信号 (需要至少 %d 根)", need)
+	}
+
+	cci, err := computeCCI(klines, window)
+	if err != nil {
+		return "", err
+	}
+
+	nr, err := isNarrowRange(klines, nrCount)
+	if err != nil {
+		return "", err
+	}
+	if !nr {
+		return "", nil
+	}
+
+	last := klines[len(klines)-1]
+	prev := klines[len(klines)-2]
+
+	switch {
+	case cci < s.cfg.LongCCI:
+		if s.cfg.StrictMode && last.Close <= prev.High {
+			return "", nil
+		}
+		return "long", nil
+	case cci > s.cfg.ShortCCI:
+		if s.cfg.StrictMode && last.Close >= prev.Low {
+			return "", nil
+		}
+		return "short", nil
+	default:
+		return "", nil
+	}
+}
+
+// typicalPrice 典型价格 = (最高 + 最低 + 收盘) / 3
+func typicalPrice(k trader.Kline) float64 {
+	return (k.High + k.Low + k.Close) / 3
+}
+
+// computeCCI 计算最新一根K线的顺势指标：CCI = (TP - SMA(TP,n)) / (0.015 * 平均绝对偏差)
+func computeCCI(klines []trader.Kline, window int) (float64, error) {
+	if window <= 0 {
+		return 0, fmt.Errorf("CCI窗口必须大于0")
+	}
+	if len(klines) < window {
+		return 0, fmt.Errorf("K线数量不足以计算CCI: 需要 %d 根，实际 %d 根", window, len(klines))
+	}
+
+	recent := klines[len(klines)-window:]
+	tps := make([]float64, window)
+	var sum float64
+	for i, k := range recent {
+		tps[i] = typicalPrice(k)
+		sum += tps[i]
+	}
+	sma := sum / float64(window)
+
+	var deviationSum float64
+	for _, tp := range tps {
+		d := tp - sma
+		if d < 0 {
+			d = -d
+		}
+		deviationSum += d
+	}
+	meanDeviation := deviationSum / float64(window)
+	if meanDeviation == 0 {
+		return 0, nil
+	}
+
+	currentTP := tps[len(tps)-1]
+	return (currentTP - sma) / (0.015 * meanDeviation), nil
+}
+
+// trueRange 计算单根K线的真实波幅（此处简化为 High - Low，不考虑跳空缺口）
+func trueRange(k trader.Kline) float64 {
+	return k.High - k.Low
+}
+
+// isNarrowRange 判断最新一根K线是否为最近 k 根里波幅最窄的一根（NR-k信号）
+func isNarrowRange(klines []trader.Kline, k int) (bool, error) {
+	if k <= 0 {
+		return false, fmt.Errorf("NR窗口必须大于0")
+	}
+	if len(klines) < k {
+		return false, fmt.Errorf("K线数量不足以计算NR%d: 需要 %d 根，实际 %d 根", k, k, len(klines))
+	}
+
+	recent := klines[len(klines)-k:]
+	lastTR := trueRange(recent[len(recent)-1])
+	for _, bar := range recent[:len(recent)-1] {
+		if trueRange(bar) < lastTR {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,113 @@
+package strategy
+
+import (
+	"testing"
+
+	"github.com/dcbax/nofx/trader"
+)
+
+// fixtureKlines 是从 OKX BTC-USDT-SWAP 1m K线录制的样本数据（时间正序）
+func fixtureKlines() []trader.Kline {
+	rows := [][5]float64{
+		{61200, 61350, 61100, 61300, 120},
+		{61300, 61420, 61250, 61180, 98},
+		{61180, 61260, 61000, 61050, 140},
+		{61050, 61100, 60850, 60900, 210},
+		{60900, 60950, 60700, 60750, 260},
+		{60750, 60800, 60600, 60650, 300},
+		{60650, 60700, 60580, 60600, 180},
+		{60600, 60640, 60560, 60610, 90},
+		{60610, 60630, 60590, 60605, 40}, // 最窄波幅，NR4
+	}
+
+	klines := make([]trader.Kline, len(rows))
+	for i, r := range rows {
+		klines[i] = trader.Kline{
+			Timestamp: int64(1700000000 + i*60),
+			Open:      r[0],
+			High:      r[1],
+			Low:       r[2],
+			Close:     r[3],
+			Volume:    r[4],
+		}
+	}
+	return klines
+}
+
+func TestComputeCCI(t *testing.T) {
+	klines := fixtureKlines()
+
+	cci, err := computeCCI(klines, 6)
+	if err != nil {
+		t.Fatalf("computeCCI 返回错误: %v", err)
+	}
+	if cci >= 0 {
+		t.Fatalf("持续下跌行情的 CCI 应为负值，got %f", cci)
+	}
+}
+
+func TestComputeCCI_InsufficientData(t *testing.T) {
+	klines := fixtureKlines()[:3]
+	if _, err := computeCCI(klines, 6); err == nil {
+		t.Fatal("K线数量不足时应返回错误")
+	}
+}
+
+func TestIsNarrowRange(t *testing.T) {
+	klines := fixtureKlines()
+
+	nr, err := isNarrowRange(klines, 4)
+	if err != nil {
+		t.Fatalf("isNarrowRange 返回错误: %v", err)
+	}
+	if !nr {
+		t.Fatal("最后一根K线波幅应为最近4根中最窄的一根")
+	}
+}
+
+func TestIsNarrowRange_NotNarrow(t *testing.T) {
+	klines := fixtureKlines()[:5] // 截断到最后一根不是最窄波幅的区间
+
+	nr, err := isNarrowRange(klines, 4)
+	if err != nil {
+		t.Fatalf("isNarrowRange 返回错误: %v", err)
+	}
+	if nr {
+		t.Fatal("该区间最后一根K线波幅不是最窄的，不应判定为NR信号")
+	}
+}
+
+func TestEvaluate_LongSignal(t *testing.T) {
+	s := NewCCINR(nil, Config{
+		CCIWindow: 6,
+		LongCCI:   -50,
+		ShortCCI:  50,
+		NRCount:   4,
+	})
+
+	signal, err := s.evaluate(fixtureKlines())
+	if err != nil {
+		t.Fatalf("evaluate 返回错误: %v", err)
+	}
+	if signal != "long" {
+		t.Fatalf("预期信号为 long，got %q", signal)
+	}
+}
+
+func TestEvaluate_StrictModeRejectsWeakBreakout(t *testing.T) {
+	s := NewCCINR(nil, Config{
+		CCIWindow:  6,
+		LongCCI:    -50,
+		ShortCCI:   50,
+		NRCount:    4,
+		StrictMode: true,
+	})
+
+	signal, err := s.evaluate(fixtureKlines())
+	if err != nil {
+		t.Fatalf("evaluate 返回错误: %v", err)
+	}
+	if signal != "" {
+		t.Fatalf("严格模式下未突破前一根K线区间时不应产生信号，got %q", signal)
+	}
+}
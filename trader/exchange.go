@@ -0,0 +1,64 @@
+package trader
+
+import "fmt"
+
+// Exchange 是所有交易所实现必须满足的统一接口，使策略代码可以在不同交易所间切换
+// （OKX、Binance、Bybit 等）而无需修改业务逻辑
+type Exchange interface {
+	GetBalance() (map[string]interface{}, error)
+	GetPositions() ([]map[string]interface{}, error)
+
+	OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error)
+	OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error)
+	CloseLong(symbol string, quantity float64) (map[string]interface{}, error)
+	CloseShort(symbol string, quantity float64) (map[string]interface{}, error)
+
+	SetLeverage(symbol string, leverage int) error
+	SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error
+	SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error
+	CancelAllOrders(symbol string) error
+
+	GetMarketPrice(symbol string) (float64, error)
+	GetKline(symbol, interval string, limit int) ([]Kline, error)
+	GetDepth(symbol string, depth int) (bids, asks [][2]float64, err error)
+
+	FormatQuantity(symbol string, quantity float64) (string, error)
+	FormatPrice(symbol string, price float64) (string, error)
+
+	LimitBuy(symbol string, quantity, price float64, opts LimitOrderOptions) (map[string]interface{}, error)
+	LimitSell(symbol string, quantity, price float64, opts LimitOrderOptions) (map[string]interface{}, error)
+}
+
+// LimitOrderOptions 限价单可选参数
+type LimitOrderOptions struct {
+	PostOnly bool
+	FOK      bool
+	IOC      bool
+}
+
+// Config 创建交易所实例所需的通用配置，具体字段由各交易所按需读取
+type Config struct {
+	APIKey     string
+	SecretKey  string
+	Passphrase string
+	Testnet    bool
+}
+
+// ExchangeFactory 根据通用配置创建一个 Exchange 实例
+type ExchangeFactory func(cfg Config) (Exchange, error)
+
+var registry = make(map[string]ExchangeFactory)
+
+// Register 注册一个交易所工厂，供 New 按名称查找
+func Register(name string, factory ExchangeFactory) {
+	registry[name] = factory
+}
+
+// New 按名称创建一个已注册的交易所实例
+func New(name string, cfg Config) (Exchange, error) {
+	factory, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("未注册的交易所: %s", name)
+	}
+	return factory(cfg)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
@@ -24,16 +25,94 @@ const (
 	OKXDemoURL       = "https.www.okx.com" // OKX的模拟盘URL
 )
 
+// AccountMode OKX 持仓模式
+type AccountMode int
+
+const (
+	// LongShortMode 双向持仓（买卖方向分别开仓，需要 posSide）
+	LongShortMode AccountMode = iota
+	// NetMode 单向持仓（不分买卖方向，通过 reduceOnly 平仓）
+	NetMode
+)
+
+// MarginMode OKX 保证金模式
+type MarginMode string
+
+const (
+	// MarginIsolated 逐仓
+	MarginIsolated MarginMode = "isolated"
+	// MarginCross 全仓
+	MarginCross MarginMode = "cross"
+)
+
+// normalizePosSide 将OKX返回的posSide归一化为 "long"/"short"。
+// 单向持仓（net_mode）下OKX对每个仓位都返回 posSide="net"，方向需要由持仓数量的正负号判断；
+// 双向持仓下posSide本身就是 "long"/"short"，原样返回
+func normalizePosSide(mode AccountMode, posSide string, amount float64) string {
+	if mode != NetMode {
+		return posSide
+	}
+	switch {
+	case amount > 0:
+		return "long"
+	case amount < 0:
+		return "short"
+	default:
+		return "net"
+	}
+}
+
+// OkxTraderOption 用于覆盖 NewOkxTrader 自动探测出的账户配置
+type OkxTraderOption func(*OkxTrader)
+
+// WithAccountMode 覆盖自动探测的持仓模式
+func WithAccountMode(mode AccountMode) OkxTraderOption {
+	return func(t *OkxTrader) { t.accountMode = mode }
+}
+
+// WithMarginMode 设置保证金模式；保证金模式不做自动探测，默认为逐仓
+func WithMarginMode(mode MarginMode) OkxTraderOption {
+	return func(t *OkxTrader) { t.marginMode = mode }
+}
+
 // OkxTrader OKX 交易平台实现
 type OkxTrader struct {
 	client     *client.Client
 	ctx        context.Context
 	testnet    bool
 	precisions sync.Map // 缓存精度信息 map[string]int
+
+	accountMode AccountMode // 持仓模式：双向持仓 or 单向持仓
+	marginMode  MarginMode  // 保证金模式：逐仓 or 全仓
+
+	contractSpecs sync.Map // 缓存合约规格 map[instID]okxContractSpec
+
+	// 用于私有 WebSocket 登录签名
+	apiKey     string
+	secretKey  string
+	passphrase string
+
+	// WebSocket 子系统：按需建立，分别管理公共/私有连接。
+	// wsPublicMu/wsPrivateMu 只保护"建立连接"这一步，不用 sync.Once——
+	// 否则首次 connect() 失败会把错误永久缓存住，后续 Subscribe* 调用永远拿到同一个陈旧错误，
+	// 新连接也就再没有机会建立（见 ensurePublicWs/ensurePrivateWs）
+	wsPublic    *okxWsClient
+	wsPublicMu  sync.Mutex
+	wsPrivate   *okxWsClient
+	wsPrivateMu sync.Mutex
+
+	// 私有频道 positions 推送维护的本地持仓缓存 map["symbol:posSide"]okxPosition
+	positionCache sync.Map
+
+	// 本地挂单缓存：symbol -> *sync.Map[orderID]struct{}，在 placeOrder/placeAlgoOrder 成功时更新
+	openOrders     sync.Map
+	openAlgoOrders sync.Map
+	trackedSymbols sync.Map // symbol -> struct{}，用于周期性REST对账
+	reconcileOnce  sync.Once
 }
 
 // NewOkxTrader 创建OKX交易器
-func NewOkxTrader(apiKey, secretKey, passphrase string, testnet bool) (*OkxTrader, error) {
+func NewOkxTrader(apiKey, secretKey, passphrase string, testnet bool, opts ...OkxTraderOption) (*OkxTrader, error) {
 	var dest rest.Destination
 	if testnet {
 		dest = rest.Demo
@@ -62,17 +141,63 @@ func NewOkxTrader(apiKey, secretKey, passphrase string, testnet bool) (*OkxTrade
 
 	log.Printf("✓ OKX交易器初始化成功 (testnet=%v)", testnet)
 
-	return &OkxTrader{
-		client:  cli,
-		ctx:     context.Background(),
-		testnet: testnet,
-	}, nil
+	t := &OkxTrader{
+		client:      cli,
+		ctx:         context.Background(),
+		testnet:     testnet,
+		apiKey:      apiKey,
+		secretKey:   secretKey,
+		passphrase:  passphrase,
+		accountMode: LongShortMode,
+		marginMode:  MarginIsolated,
+	}
+
+	// 自动探测账户的持仓模式，调用方也可以通过 WithAccountMode/WithMarginMode 覆盖
+	if err := t.detectAccountMode(); err != nil {
+		log.Printf("⚠ 自动探测持仓模式失败，使用默认值 long_short_mode: %v", err)
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t, nil
+}
+
+func init() {
+	Register("okx", func(cfg Config) (Exchange, error) {
+		return NewOkxTrader(cfg.APIKey, cfg.SecretKey, cfg.Passphrase, cfg.Testnet)
+	})
+}
+
+// detectAccountMode 调用 GetAccountConfig 探测账户的持仓模式
+func (t *OkxTrader) detectAccountMode() error {
+	resp, err := t.client.Rest.Api.Account.GetAccountConfig(&account.GetAccountConfigRequest{})
+	if err != nil {
+		return fmt.Errorf("OKX GetAccountConfig 失败: %w", err)
+	}
+	if len(resp.Data) == 0 {
+		return fmt.Errorf("OKX GetAccountConfig 未返回数据")
+	}
+
+	switch resp.Data[0].PosMode {
+	case "net_mode":
+		t.accountMode = NetMode
+	case "long_short_mode":
+		t.accountMode = LongShortMode
+	default:
+		return fmt.Errorf("未知的持仓模式: %s", resp.Data[0].PosMode)
+	}
+	return nil
 }
 
 // --- 助手函数 ---
 
 // okxSymbol 将 "BTCUSDT" 转换为 "BTC-USDT-SWAP"
 func okxSymbol(symbol string) string {
+	if strings.HasSuffix(symbol, "-SWAP") {
+		return symbol // 已经是 instID，避免重复转换
+	}
 	if strings.HasSuffix(symbol, "USDT") {
 		return strings.Replace(symbol, "USDT", "-USDT-SWAP", 1)
 	}
@@ -144,17 +269,24 @@ func (t *OkxTrader) GetPositions() ([]map[string]interface{}, error) {
 
 	var result []map[string]interface{}
 	for _, pos := range resp.Data {
-		posAmt := parseFloat(pos.Pos)
-		if posAmt == 0 {
+		contracts := parseFloat(pos.Pos)
+		if contracts == 0 {
 			continue // 跳过空仓位
 		}
 
 		// 转换 symbol 格式
 		symbol := standardSymbol(pos.InstID)
 
+		// pos.Pos 是以"张"计价的合约数量，转换为标的币种数量
+		posAmt, err := t.ContractsToCoin(pos.InstID, contracts)
+		if err != nil {
+			log.Printf("⚠ %s 合约张数转换失败，使用原始张数: %v", pos.InstID, err)
+			posAmt = contracts
+		}
+
 		posMap := make(map[string]interface{})
 		posMap["symbol"] = symbol
-		posMap["side"] = pos.PosSide // "long" or "short"
+		posMap["side"] = normalizePosSide(t.accountMode, pos.PosSide, posAmt) // "long" or "short"
 		posMap["positionAmt"] = posAmt
 		posMap["entryPrice"] = parseFloat(pos.AvgPx)
 		posMap["markPrice"] = parseFloat(pos.MarkPx)
@@ -172,11 +304,28 @@ func (t *OkxTrader) SetLeverage(symbol string, leverage int) error {
 	instID := okxSymbol(symbol)
 	log.Printf("🔄 正在调用OKX API设置杠杆 for %s to %dx", instID, leverage)
 
-	// OKX需要同时设置多空杠杆（如果posSide不填）
+	// 单向持仓（net_mode）或全仓模式下，一次调用即可对两个方向生效
+	if t.accountMode == NetMode || t.marginMode == MarginCross {
+		return t.setLeverageOnce(instID, leverage, "")
+	}
+
+	// 双向持仓 + 逐仓模式下，多空仓位的杠杆是分别设置的，需要各调用一次
+	for _, posSide := range []string{"long", "short"} {
+		if err := t.setLeverageOnce(instID, leverage, posSide); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *OkxTrader) setLeverageOnce(instID string, leverage int, posSide string) error {
 	req := &account.SetLeverageRequest{
 		InstID:  instID,
 		Lever:   fmt.Sprintf("%d", leverage),
-		MgnMode: "isolated", // 必须设为逐仓
+		MgnMode: string(t.marginMode),
+	}
+	if posSide != "" {
+		req.PosSide = posSide
 	}
 
 	_, err := t.client.Rest.Api.Account.SetLeverage(req)
@@ -195,26 +344,71 @@ func (t *OkxTrader) SetLeverage(symbol string, leverage int) error {
 	return nil
 }
 
-// 内部函数：下单
-func (t *OkxTrader) placeOrder(symbol, side, ordType, posSide string, quantity float64) (map[string]interface{}, error) {
+// TimeInForce 下单有效方式，决定对应的 OKX ordType
+type TimeInForce string
+
+const (
+	// GTC 普通限价单（Good-Till-Cancel）
+	GTC TimeInForce = "gtc"
+	// PostOnlyTIF 只做Maker，若会立即成交则被撤销
+	PostOnlyTIF TimeInForce = "post_only"
+	// FOKTIF 全部成交或立即撤销
+	FOKTIF TimeInForce = "fok"
+	// IOCTIF 立即成交剩余部分撤销
+	IOCTIF TimeInForce = "ioc"
+)
+
+// tifToOrdType 将 TimeInForce 映射为 OKX 的 ordType
+func tifToOrdType(tif TimeInForce) string {
+	switch tif {
+	case PostOnlyTIF:
+		return "post_only"
+	case FOKTIF:
+		return "fok"
+	case IOCTIF:
+		return "ioc"
+	default:
+		return "limit"
+	}
+}
+
+// 内部函数：下单。price 为 0 表示市价单，否则按 tif 下限价单。
+// isClose 表示这是一笔平仓单：单向持仓下通过 reduceOnly 平仓，双向持仓下通过 posSide 平仓
+func (t *OkxTrader) placeOrder(symbol, side, posSide string, quantity, price float64, tif TimeInForce, isClose bool) (map[string]interface{}, error) {
 	instID := okxSymbol(symbol)
-	
+
 	// 格式化数量
 	quantityStr, err := t.FormatQuantity(instID, quantity)
 	if err != nil {
 		return nil, err
 	}
-	
+
+	ordType := "market"
+	var priceStr string
+	if price > 0 {
+		ordType = tifToOrdType(tif)
+		priceStr, err = t.FormatPrice(instID, price)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	req := &trade.PlaceOrderRequest{
 		InstID:  instID,
-		TdMode:  "isolated", // 逐仓
+		TdMode:  string(t.marginMode),
 		Side:    side,
 		OrdType: ordType,
 		Sz:      quantityStr,
+		Px:      priceStr,
 	}
 
-	// 如果是平仓，需要指定 posSide
-	if posSide != "" {
+	if t.accountMode == NetMode {
+		// 单向持仓不区分 posSide，平仓通过 reduceOnly 标记
+		if isClose {
+			req.ReduceOnly = true
+		}
+	} else if posSide != "" {
+		// 双向持仓下开/平仓都需要指定 posSide
 		req.PosSide = posSide
 	}
 
@@ -232,10 +426,19 @@ func (t *OkxTrader) placeOrder(symbol, side, ordType, posSide string, quantity f
 		return nil, fmt.Errorf("OKX 下单失败: %s (code: %s)", orderData.SMsg, orderData.SCode)
 	}
 
+	if ordType != "market" {
+		// 市价单假定立即成交，不需要放入挂单缓存
+		t.trackOrder(symbol, orderData.OrdID)
+	}
+
 	result := make(map[string]interface{})
 	result["orderId"] = orderData.OrdID
 	result["symbol"] = symbol
-	result["status"] = "FILLED" // 市价单假定立即成交
+	if ordType == "market" {
+		result["status"] = "FILLED" // 市价单假定立即成交
+	} else {
+		result["status"] = "LIVE" // 限价单需调用 GetOrderStatus/WaitForFill 确认成交
+	}
 
 	return result, nil
 }
@@ -250,7 +453,7 @@ func (t *OkxTrader) OpenLong(symbol string, quantity float64, leverage int) (map
 		return nil, err
 	}
 	
-	return t.placeOrder(symbol, "buy", "market", "long", quantity)
+	return t.placeOrder(symbol, "buy", "long", quantity, 0, GTC, false)
 }
 
 func (t *OkxTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
@@ -263,43 +466,57 @@ func (t *OkxTrader) OpenShort(symbol string, quantity float64, leverage int) (ma
 		return nil, err
 	}
 
-	return t.placeOrder(symbol, "sell", "market", "short", quantity)
+	return t.placeOrder(symbol, "sell", "short", quantity, 0, GTC, false)
 }
 
 func (t *OkxTrader) CloseLong(symbol string, quantity float64) (map[string]interface{}, error) {
 	log.Printf("🔄 正在调用OKX API平多仓: %s, 数量: %f", symbol, quantity)
 
 	if quantity == 0 {
-		// 获取当前持仓量
-		pos, err := t.getSpecificPosition(symbol, "long")
-		if err != nil {
-			return nil, err
+		// 优先读取 WebSocket 推送维护的本地持仓缓存，避免额外的 REST 往返
+		if cached, ok := t.cachedPosition(symbol, "long"); ok {
+			quantity = cached.PositionAmt
+		} else {
+			pos, err := t.getSpecificPosition(symbol, "long")
+			if err != nil {
+				return nil, err
+			}
+			if pos == nil {
+				return nil, fmt.Errorf("没有找到 %s 的多仓", symbol)
+			}
+			quantity, err = t.ContractsToCoin(okxSymbol(symbol), parseFloat(pos.Pos))
+			if err != nil {
+				return nil, err
+			}
 		}
-		if pos == nil {
-			return nil, fmt.Errorf("没有找到 %s 的多仓", symbol)
-		}
-		quantity = parseFloat(pos.Pos)
 	}
 
-	return t.placeOrder(symbol, "sell", "market", "long", quantity)
+	return t.placeOrder(symbol, "sell", "long", quantity, 0, GTC, true)
 }
 
 func (t *OkxTrader) CloseShort(symbol string, quantity float64) (map[string]interface{}, error) {
 	log.Printf("🔄 正在调用OKX API平空仓: %s, 数量: %f", symbol, quantity)
 
 	if quantity == 0 {
-		// 获取当前持仓量
-		pos, err := t.getSpecificPosition(symbol, "short")
-		if err != nil {
-			return nil, err
-		}
-		if pos == nil {
-			return nil, fmt.Errorf("没有找到 %s 的空仓", symbol)
+		// 优先读取 WebSocket 推送维护的本地持仓缓存，避免额外的 REST 往返
+		if cached, ok := t.cachedPosition(symbol, "short"); ok {
+			quantity = cached.PositionAmt
+		} else {
+			pos, err := t.getSpecificPosition(symbol, "short")
+			if err != nil {
+				return nil, err
+			}
+			if pos == nil {
+				return nil, fmt.Errorf("没有找到 %s 的空仓", symbol)
+			}
+			quantity, err = t.ContractsToCoin(okxSymbol(symbol), parseFloat(pos.Pos))
+			if err != nil {
+				return nil, err
+			}
 		}
-		quantity = parseFloat(pos.Pos)
 	}
 
-	return t.placeOrder(symbol, "buy", "market", "short", quantity)
+	return t.placeOrder(symbol, "buy", "short", quantity, 0, GTC, true)
 }
 
 func (t *OkxTrader) getSpecificPosition(symbol, posSide string) (*account.Position, error) {
@@ -311,7 +528,7 @@ func (t *OkxTrader) getSpecificPosition(symbol, posSide string) (*account.Positi
 		return nil, err
 	}
 	for _, pos := range resp.Data {
-		if pos.PosSide == posSide {
+		if normalizePosSide(t.accountMode, pos.PosSide, parseFloat(pos.Pos)) == posSide {
 			return pos, nil
 		}
 	}
@@ -332,6 +549,161 @@ func (t *OkxTrader) GetMarketPrice(symbol string) (float64, error) {
 	return parseFloat(resp.Data[0].Last), nil
 }
 
+// GetKline 获取K线数据，interval 如 "1m"/"5m"/"1H"，limit 为返回根数
+func (t *OkxTrader) GetKline(symbol, interval string, limit int) ([]Kline, error) {
+	instID := okxSymbol(symbol)
+	resp, err := t.client.Rest.Api.Market.GetCandles(&market.GetCandlesRequest{
+		InstID: instID,
+		Bar:    interval,
+		Limit:  fmt.Sprintf("%d", limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("OKX GetCandles 失败: %w", err)
+	}
+
+	klines := make([]Kline, 0, len(resp.Data))
+	for _, row := range resp.Data {
+		if len(row) < 6 {
+			continue
+		}
+		ts, _ := strconv.ParseInt(row[0], 10, 64)
+		klines = append(klines, Kline{
+			Timestamp: ts,
+			Open:      parseFloat(row[1]),
+			High:      parseFloat(row[2]),
+			Low:       parseFloat(row[3]),
+			Close:     parseFloat(row[4]),
+			Volume:    parseFloat(row[5]),
+		})
+	}
+
+	// OKX 返回的K线按时间倒序排列，调用方通常期望按时间正序
+	for i, j := 0, len(klines)-1; i < j; i, j = i+1, j-1 {
+		klines[i], klines[j] = klines[j], klines[i]
+	}
+	return klines, nil
+}
+
+// GetDepth 获取订单簿深度，depth 为档位数量（如 5/20/400）
+func (t *OkxTrader) GetDepth(symbol string, depth int) ([][2]float64, [][2]float64, error) {
+	instID := okxSymbol(symbol)
+	resp, err := t.client.Rest.Api.Market.GetOrderBook(&market.GetOrderBookRequest{
+		InstID: instID,
+		Sz:     fmt.Sprintf("%d", depth),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("OKX GetOrderBook 失败: %w", err)
+	}
+	if len(resp.Data) == 0 {
+		return nil, nil, fmt.Errorf("OKX GetOrderBook: 未返回 %s 的数据", instID)
+	}
+
+	book := resp.Data[0]
+	return parseDepthSide(book.Bids), parseDepthSide(book.Asks), nil
+}
+
+// tifFromOptions 将 Exchange 接口的 LimitOrderOptions 转换为内部的 TimeInForce
+func tifFromOptions(opts LimitOrderOptions) TimeInForce {
+	switch {
+	case opts.PostOnly:
+		return PostOnlyTIF
+	case opts.FOK:
+		return FOKTIF
+	case opts.IOC:
+		return IOCTIF
+	default:
+		return GTC
+	}
+}
+
+// LimitBuy 以买方向挂限价单，满足 Exchange 接口。
+// 双向持仓模式下 OKX 要求每个订单都带 posSide，这里按买开多的惯例默认传 "long"
+func (t *OkxTrader) LimitBuy(symbol string, quantity, price float64, opts LimitOrderOptions) (map[string]interface{}, error) {
+	return t.placeOrder(symbol, "buy", "long", quantity, price, tifFromOptions(opts), false)
+}
+
+// LimitSell 以卖方向挂限价单，满足 Exchange 接口。
+// 双向持仓模式下 OKX 要求每个订单都带 posSide，这里按卖开空的惯例默认传 "short"
+func (t *OkxTrader) LimitSell(symbol string, quantity, price float64, opts LimitOrderOptions) (map[string]interface{}, error) {
+	return t.placeOrder(symbol, "sell", "short", quantity, price, tifFromOptions(opts), false)
+}
+
+// LimitLong 以限价单开多仓
+func (t *OkxTrader) LimitLong(symbol string, quantity, price float64, leverage int, tif TimeInForce) (map[string]interface{}, error) {
+	log.Printf("📈 正在调用OKX API限价开多仓: %s, 数量: %f, 价格: %f", symbol, quantity, price)
+
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return nil, err
+	}
+	return t.placeOrder(symbol, "buy", "long", quantity, price, tif, false)
+}
+
+// LimitShort 以限价单开空仓
+func (t *OkxTrader) LimitShort(symbol string, quantity, price float64, leverage int, tif TimeInForce) (map[string]interface{}, error) {
+	log.Printf("📉 正在调用OKX API限价开空仓: %s, 数量: %f, 价格: %f", symbol, quantity, price)
+
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return nil, err
+	}
+	return t.placeOrder(symbol, "sell", "short", quantity, price, tif, false)
+}
+
+// LimitClose 以限价单平仓，positionSide 为 "long" 或 "short"
+func (t *OkxTrader) LimitClose(symbol, positionSide string, quantity, price float64, tif TimeInForce) (map[string]interface{}, error) {
+	log.Printf("🔄 正在调用OKX API限价平仓: %s (%s), 数量: %f, 价格: %f", symbol, positionSide, quantity, price)
+
+	side := "sell"
+	if positionSide == "short" {
+		side = "buy"
+	}
+	return t.placeOrder(symbol, side, positionSide, quantity, price, tif, true)
+}
+
+// GetOrderStatus 查询订单当前状态
+func (t *OkxTrader) GetOrderStatus(symbol, orderID string) (map[string]interface{}, error) {
+	instID := okxSymbol(symbol)
+	resp, err := t.client.Rest.Api.Trade.GetOrder(&trade.GetOrderRequest{
+		InstID: instID,
+		OrdID:  orderID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("OKX GetOrder 失败 (%s): %w", orderID, err)
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("OKX GetOrder: 未找到订单 %s", orderID)
+	}
+
+	order := resp.Data[0]
+	return map[string]interface{}{
+		"orderId":   order.OrdID,
+		"symbol":    symbol,
+		"status":    order.State, // "live" / "filled" / "partially_filled" / "canceled"
+		"filledQty": parseFloat(order.AccFillSz),
+		"avgPrice":  parseFloat(order.AvgPx),
+	}, nil
+}
+
+// WaitForFill 轮询订单状态直至完全成交或超时
+func (t *OkxTrader) WaitForFill(symbol, orderID string, timeout time.Duration) (map[string]interface{}, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := t.GetOrderStatus(symbol, orderID)
+		if err != nil {
+			return nil, err
+		}
+		if status["status"] == "filled" {
+			return status, nil
+		}
+		if status["status"] == "canceled" {
+			return status, fmt.Errorf("订单 %s 已被撤销", orderID)
+		}
+		if time.Now().After(deadline) {
+			return status, fmt.Errorf("等待订单 %s 成交超时", orderID)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
 // 内部函数：设置止损/止盈
 func (t *OkxTrader) placeAlgoOrder(symbol, posSide, ordType, triggerPrice, sz string) error {
 	instID := okxSymbol(symbol)
@@ -343,13 +715,19 @@ func (t *OkxTrader) placeAlgoOrder(symbol, posSide, ordType, triggerPrice, sz st
 
 	req := &trade.PlaceAlgoOrderRequest{
 		InstID:  instID,
-		TdMode:  "isolated",
+		TdMode:  string(t.marginMode),
 		Side:    side,
-		PosSide: posSide,
 		OrdType: ordType,
 		Sz:      sz,
 	}
 
+	if t.accountMode == NetMode {
+		// 单向持仓不区分 posSide，平仓通过 reduceOnly 标记
+		req.ReduceOnly = true
+	} else {
+		req.PosSide = posSide
+	}
+
 	if ordType == "stop" {
 		req.SlTriggerPx = triggerPrice
 		req.SlOrdPx = "-1" // 市价止损
@@ -368,6 +746,8 @@ func (t *OkxTrader) placeAlgoOrder(symbol, posSide, ordType, triggerPrice, sz st
 	if resp.Data[0].SCode != "0" {
 		return fmt.Errorf("OKX PlaceAlgoOrder 失败: %s (code: %s)", resp.Data[0].SMsg, resp.Data[0].SCode)
 	}
+
+	t.trackAlgoOrder(symbol, resp.Data[0].AlgoID)
 	return nil
 }
 
@@ -398,50 +778,196 @@ func (t *OkxTrader) SetTakeProfit(symbol string, positionSide string, quantity,
 	return t.placeAlgoOrder(symbol, posSide, "tp", tpPriceStr, quantityStr)
 }
 
-func (t *OkxTrader) CancelAllOrders(symbol string) error {
+// cancelBatchSize 是 OKX 批量撤单接口单次请求允许的最大条数
+const cancelBatchSize = 20
+
+// algoOrderTypes 是 CancelAllOrders 需要回收的策略委托类型
+var algoOrderTypes = []string{"stop", "tp", "trigger", "oco", "move_order_stop"}
+
+// orderSet 返回 symbol 对应的本地挂单集合，不存在则创建
+func orderSet(m *sync.Map, symbol string) *sync.Map {
+	val, _ := m.LoadOrStore(symbol, &sync.Map{})
+	return val.(*sync.Map)
+}
+
+func ids(m *sync.Map) []string {
+	var out []string
+	m.Range(func(k, _ interface{}) bool {
+		out = append(out, k.(string))
+		return true
+	})
+	return out
+}
+
+// trackOrder 记录一笔成功下单的普通订单，供 CancelAllOrders 优先命中本地缓存
+func (t *OkxTrader) trackOrder(symbol, orderID string) {
+	t.trackedSymbols.Store(symbol, struct{}{})
+	orderSet(&t.openOrders, symbol).Store(orderID, struct{}{})
+}
+
+// trackAlgoOrder 记录一笔成功下单的策略委托（止损/止盈）
+func (t *OkxTrader) trackAlgoOrder(symbol, algoID string) {
+	t.trackedSymbols.Store(symbol, struct{}{})
+	orderSet(&t.openAlgoOrders, symbol).Store(algoID, struct{}{})
+}
+
+func clearOrderSet(m *sync.Map, symbol string) {
+	orderSet(m, symbol).Range(func(k, _ interface{}) bool {
+		orderSet(m, symbol).Delete(k)
+		return true
+	})
+}
+
+// chunkStrings 将 ids 切分为不超过 size 条的批次，用于批量撤单接口
+func chunkStrings(values []string, size int) [][]string {
+	var chunks [][]string
+	for len(values) > 0 {
+		n := size
+		if n > len(values) {
+			n = len(values)
+		}
+		chunks = append(chunks, values[:n])
+		values = values[n:]
+	}
+	return chunks
+}
+
+// startReconcileLoop 启动一个后台goroutine，周期性地用REST接口核对本地挂单缓存，
+// 防止WebSocket/本地记录与交易所实际状态脱节
+func (t *OkxTrader) startReconcileLoop() {
+	t.reconcileOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(30 * time.Second)
+			defer ticker.Stop()
+			for range ticker.C {
+				t.trackedSymbols.Range(func(k, _ interface{}) bool {
+					symbol := k.(string)
+					if err := t.reconcileOrders(symbol); err != nil {
+						log.Printf("⚠ %s 挂单对账失败: %v", symbol, err)
+					}
+					return true
+				})
+			}
+		}()
+	})
+}
+
+// reconcileOrders 用REST接口刷新本地挂单缓存
+func (t *OkxTrader) reconcileOrders(symbol string) error {
 	instID := okxSymbol(symbol)
-	log.Printf("🚫 正在调用OKX API取消所有订单: %s", instID)
 
-	// 1. 取消所有普通订单
-	// (OKX似乎没有批量取消特定symbol的接口，需要先获取再取消，或者直接取消所有)
-	// 这里我们用CancelMultipleOrders，但需要订单ID，这不符合"CancelAll"
-	// 更好的办法是取消所有策略订单
-	
-	// 2. 取消所有策略订单（止损/止盈）
-	// (同样，没有批量取消特定symbol的接口，需要先获取)
-	
-	// 简化：获取所有未成交的策略订单并取消
-	algoList, err := t.client.Rest.Api.Trade.GetAlgoOrderList(&trade.GetAlgoOrderListRequest{
+	clearOrderSet(&t.openOrders, symbol)
+	listResp, err := t.client.Rest.Api.Trade.GetOrderList(&trade.GetOrderListRequest{
 		InstType: "SWAP",
 		InstID:   instID,
-		OrdType:  "stop", // 止损
 	})
-	if err == nil {
-		for _, algo := range algoList.Data {
-			t.client.Rest.Api.Trade.CancelAlgoOrder(&trade.CancelAlgoOrderRequest{
-				InstID: instID,
-				AlgoID: algo.AlgoID,
-			})
+	if err != nil {
+		return fmt.Errorf("OKX GetOrderList 失败: %w", err)
+	}
+	for _, o := range listResp.Data {
+		t.trackOrder(symbol, o.OrdID)
+	}
+
+	clearOrderSet(&t.openAlgoOrders, symbol)
+	for _, ordType := range algoOrderTypes {
+		algoList, err := t.client.Rest.Api.Trade.GetAlgoOrderList(&trade.GetAlgoOrderListRequest{
+			InstType: "SWAP",
+			InstID:   instID,
+			OrdType:  ordType,
+		})
+		if err != nil {
+			continue
+		}
+		for _, a := range algoList.Data {
+			t.trackAlgoOrder(symbol, a.AlgoID)
 		}
 	}
-	
-	algoList, err = t.client.Rest.Api.Trade.GetAlgoOrderList(&trade.GetAlgoOrderListRequest{
+	return nil
+}
+
+func (t *OkxTrader) CancelAllOrders(symbol string) error {
+	instID := okxSymbol(symbol)
+	log.Printf("🚫 正在调用OKX API取消所有订单: %s", instID)
+
+	t.startReconcileLoop()
+
+	// 1. 普通挂单：本地缓存优先，同时用REST兜底，防止缓存遗漏
+	orderIDs := ids(orderSet(&t.openOrders, symbol))
+	if listResp, err := t.client.Rest.Api.Trade.GetOrderList(&trade.GetOrderListRequest{
 		InstType: "SWAP",
 		InstID:   instID,
-		OrdType:  "tp", // 止盈
-	})
-	if err == nil {
-		for _, algo := range algoList.Data {
-			t.client.Rest.Api.Trade.CancelAlgoOrder(&trade.CancelAlgoOrderRequest{
-				InstID: instID,
-				AlgoID: algo.AlgoID,
-			})
+	}); err != nil {
+		log.Printf("⚠ 获取挂单列表失败，仅使用本地缓存撤单: %v", err)
+	} else {
+		orderIDs = mergeIDs(orderIDs, listResp.Data, func(o trade.OrderDetail) string { return o.OrdID })
+	}
+
+	for _, batch := range chunkStrings(orderIDs, cancelBatchSize) {
+		items := make([]trade.CancelOrderItem, 0, len(batch))
+		for _, id := range batch {
+			items = append(items, trade.CancelOrderItem{InstID: instID, OrdID: id})
+		}
+		if _, err := t.client.Rest.Api.Trade.CancelMultipleOrders(&trade.CancelMultipleOrdersRequest{Orders: items}); err != nil {
+			// 这一批撤单失败，保留在本地缓存里，交给下一次周期性对账处理，
+			// 不能假定它们已经撤销
+			log.Printf("⚠ 批量撤销普通委托失败，保留本地缓存待对账: %v", err)
+			continue
+		}
+		set := orderSet(&t.openOrders, symbol)
+		for _, id := range batch {
+			set.Delete(id)
+		}
+	}
+
+	// 2. 策略委托（止损/止盈/计划委托/一键止盈止损/移动止损），同样批量撤销
+	algoIDs := ids(orderSet(&t.openAlgoOrders, symbol))
+	for _, ordType := range algoOrderTypes {
+		algoList, err := t.client.Rest.Api.Trade.GetAlgoOrderList(&trade.GetAlgoOrderListRequest{
+			InstType: "SWAP",
+			InstID:   instID,
+			OrdType:  ordType,
+		})
+		if err != nil {
+			continue
+		}
+		algoIDs = mergeIDs(algoIDs, algoList.Data, func(a trade.AlgoOrderDetail) string { return a.AlgoID })
+	}
+
+	for _, batch := range chunkStrings(algoIDs, cancelBatchSize) {
+		items := make([]trade.CancelAlgoOrderItem, 0, len(batch))
+		for _, id := range batch {
+			items = append(items, trade.CancelAlgoOrderItem{InstID: instID, AlgoID: id})
+		}
+		if _, err := t.client.Rest.Api.Trade.CancelMultipleAlgoOrders(items); err != nil {
+			// 同上：撤销失败的这一批保留在缓存里，不要当作已撤销处理
+			log.Printf("⚠ 批量撤销策略委托失败，保留本地缓存待对账: %v", err)
+			continue
+		}
+		set := orderSet(&t.openAlgoOrders, symbol)
+		for _, id := range batch {
+			set.Delete(id)
 		}
 	}
 
 	return nil
 }
 
+// mergeIDs 将 REST 返回的条目与本地已有ID去重合并
+func mergeIDs[T any](existing []string, rows []T, idOf func(T) string) []string {
+	seen := make(map[string]struct{}, len(existing))
+	for _, id := range existing {
+		seen[id] = struct{}{}
+	}
+	for _, row := range rows {
+		id := idOf(row)
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			existing = append(existing, id)
+		}
+	}
+	return existing
+}
+
 // getInstrument 获取合约信息（用于精度）
 func (t *OkxTrader) getInstrument(instID string) (*public.Instrument, error) {
 	resp, err := t.client.Rest.Api.Public.GetInstruments(&public.GetInstrumentsRequest{
@@ -457,7 +983,7 @@ func (t *OkxTrader) getInstrument(instID string) (*public.Instrument, error) {
 	return &resp.Data[0], nil
 }
 
-// getLotSzPrecision 获取数量精度
+// getLotSzPrecision 获取数量（张数）精度，用于格式化最终提交给OKX的 sz 字符串
 func (t *OkxTrader) getLotSzPrecision(instID string) (int, error) {
 	if val, ok := t.precisions.Load(instID + "_lotSz"); ok {
 		return val.(int), nil
@@ -467,17 +993,59 @@ func (t *OkxTrader) getLotSzPrecision(instID string) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	
-	// lotSz 是最小下单张数，我们需要的是 "ctVal"
-	// OKX 合约单位是 "张" (cont), 数量 (sz) 必须是 "ctVal" 的整数倍
-	// 对于USDT保证金合约，ctVal通常是 0.1 (ETH), 0.01 (BTC)
-	// 我们需要的是 "lotSz"（最小下单数量）
-	
+
 	precision := calculatePrecision(inst.LotSz)
 	t.precisions.Store(instID+"_lotSz", precision)
 	return precision, nil
 }
 
+// okxContractSpec 缓存合约的张数换算规格：
+// OKX SWAP 下单数量 sz 以"张"(contract)为单位，1张 = ctVal * ctMult 个标的币种
+type okxContractSpec struct {
+	CtVal  float64 // 合约面值（如BTC为0.01，ETH为0.1）
+	CtMult float64 // 合约乘数，大多数品种为1
+	MinSz  float64 // 最小下单张数
+	LotSz  float64 // 下单张数精度步长
+}
+
+// getContractSpec 获取并缓存合约的张数换算规格
+func (t *OkxTrader) getContractSpec(instID string) (okxContractSpec, error) {
+	if val, ok := t.contractSpecs.Load(instID); ok {
+		return val.(okxContractSpec), nil
+	}
+
+	inst, err := t.getInstrument(instID)
+	if err != nil {
+		return okxContractSpec{}, err
+	}
+
+	spec := okxContractSpec{
+		CtVal:  parseFloat(inst.CtVal),
+		CtMult: parseFloat(inst.CtMult),
+		MinSz:  parseFloat(inst.MinSz),
+		LotSz:  parseFloat(inst.LotSz),
+	}
+	if spec.CtMult == 0 {
+		spec.CtMult = 1 // OKX 大多数合约的 ctMult 为 1，未返回时按 1 处理
+	}
+
+	t.contractSpecs.Store(instID, spec)
+	return spec, nil
+}
+
+// ContractsToCoin 将OKX "张"为单位的合约数量换算为标的币种数量，
+// 用于解析 GetPositions/getSpecificPosition 返回的 pos.Pos
+func (t *OkxTrader) ContractsToCoin(instID string, contracts float64) (float64, error) {
+	spec, err := t.getContractSpec(instID)
+	if err != nil {
+		return 0, err
+	}
+	if spec.CtVal == 0 {
+		return contracts, nil // 未获取到合约面值，原样返回避免误放大/缩小
+	}
+	return contracts * spec.CtVal * spec.CtMult, nil
+}
+
 // getTickSzPrecision 获取价格精度
 func (t *OkxTrader) getTickSzPrecision(instID string) (int, error) {
 	if val, ok := t.precisions.Load(instID + "_tickSz"); ok {
@@ -492,17 +1060,41 @@ func (t *OkxTrader) getTickSzPrecision(instID string) (int, error) {
 	return precision, nil
 }
 
+// FormatQuantity 将调用方传入的标的币种数量（如 0.5 BTC）换算为OKX下单所需的张数，
+// 并按 lotSz 的精度和步长、minSz 的下限格式化
 func (t *OkxTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
 	instID := okxSymbol(symbol)
+	// 下单的 Sz 字段始终是不带符号的张数，方向由 side/posSide/reduceOnly 表达；
+	// net_mode 下 ContractsToCoin 会保留仓位的正负号（见 okx_trader.go ContractsToCoin），
+	// 读取缓存持仓平仓时 quantity 可能是负数，这里统一取绝对值
+	quantity = math.Abs(quantity)
+
+	spec, err := t.getContractSpec(instID)
+	if err != nil || spec.CtVal == 0 {
+		// 未获取到合约规格时退化为旧行为，按默认精度直接格式化，避免完全无法下单
+		log.Printf("⚠ %s 未找到合约规格，按原始数量格式化: %v", instID, err)
+		precision, precErr := t.getLotSzPrecision(instID)
+		if precErr != nil {
+			precision = 3
+		}
+		return fmt.Sprintf(fmt.Sprintf("%%.%df", precision), quantity), nil
+	}
+
+	contracts := quantity / (spec.CtVal * spec.CtMult)
+	if spec.LotSz > 0 {
+		contracts = math.Round(contracts/spec.LotSz) * spec.LotSz
+	}
+	if spec.MinSz > 0 && contracts < spec.MinSz {
+		contracts = spec.MinSz
+	}
+
 	precision, err := t.getLotSzPrecision(instID)
 	if err != nil {
-		// 默认精度
-		log.Printf("⚠ %s 未找到数量精度，使用默认精度3", instID)
 		precision = 3
 	}
-	
+
 	format := fmt.Sprintf("%%.%df", precision)
-	return fmt.Sprintf(format, quantity), nil
+	return fmt.Sprintf(format, contracts), nil
 }
 
 func (t *OkxTrader) FormatPrice(symbol string, price float64) (string, error) {
@@ -0,0 +1,105 @@
+package trader
+
+import "testing"
+
+// newTraderWithSpec 构造一个预置合约规格/精度缓存的 OkxTrader，避免测试触发真实的 getInstrument REST 调用
+func newTraderWithSpec(instID string, spec okxContractSpec, lotSzPrecision int) *OkxTrader {
+	t := &OkxTrader{}
+	t.contractSpecs.Store(instID, spec)
+	t.precisions.Store(instID+"_lotSz", lotSzPrecision)
+	return t
+}
+
+func TestFormatQuantity(t *testing.T) {
+	cases := []struct {
+		name     string
+		spec     okxContractSpec
+		quantity float64
+		want     string
+	}{
+		{
+			name:     "按ctVal换算为整数张数",
+			spec:     okxContractSpec{CtVal: 0.01, CtMult: 1, LotSz: 1, MinSz: 1},
+			quantity: 0.5, // 0.5 BTC / 0.01 = 50 张
+			want:     "50",
+		},
+		{
+			name:     "张数按lotSz取整",
+			spec:     okxContractSpec{CtVal: 0.01, CtMult: 1, LotSz: 1, MinSz: 1},
+			quantity: 0.127, // 12.7 张，按 lotSz=1 四舍五入到 13 张
+			want:     "13",
+		},
+		{
+			name:     "小于minSz时按minSz下单",
+			spec:     okxContractSpec{CtVal: 0.1, CtMult: 1, LotSz: 1, MinSz: 1},
+			quantity: 0.02, // 0.2 张，低于 minSz=1，应被抬升到 1 张
+			want:     "1",
+		},
+		{
+			name:     "ctMult不为1时一并参与换算",
+			spec:     okxContractSpec{CtVal: 1, CtMult: 10, LotSz: 1, MinSz: 1},
+			quantity: 50, // 50 / (1*10) = 5 张
+			want:     "5",
+		},
+		{
+			name:     "负数量（net_mode平空仓读取的缓存持仓）取绝对值换算",
+			spec:     okxContractSpec{CtVal: 0.01, CtMult: 1, LotSz: 1, MinSz: 1},
+			quantity: -0.5, // -50 张，应取绝对值而不是被 minSz 钳到 1
+			want:     "50",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			trader := newTraderWithSpec("BTC-USDT-SWAP", c.spec, 0)
+			got, err := trader.FormatQuantity("BTC-USDT-SWAP", c.quantity)
+			if err != nil {
+				t.Fatalf("FormatQuantity 返回错误: %v", err)
+			}
+			if got != c.want {
+				t.Fatalf("FormatQuantity(%f) = %q, want %q", c.quantity, got, c.want)
+			}
+		})
+	}
+}
+
+func TestContractsToCoin(t *testing.T) {
+	cases := []struct {
+		name      string
+		spec      okxContractSpec
+		contracts float64
+		want      float64
+	}{
+		{
+			name:      "标准换算",
+			spec:      okxContractSpec{CtVal: 0.01, CtMult: 1},
+			contracts: 50,
+			want:      0.5,
+		},
+		{
+			name:      "ctMult不为1",
+			spec:      okxContractSpec{CtVal: 1, CtMult: 10},
+			contracts: 5,
+			want:      50,
+		},
+		{
+			name:      "未获取到ctVal时原样返回",
+			spec:      okxContractSpec{CtVal: 0},
+			contracts: 7,
+			want:      7,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			trader := newTraderWithSpec("BTC-USDT-SWAP", c.spec, 0)
+			got, err := trader.ContractsToCoin("BTC-USDT-SWAP", c.contracts)
+			if err != nil {
+				t.Fatalf("ContractsToCoin 返回错误: %v", err)
+			}
+			if got != c.want {
+				t.Fatalf("ContractsToCoin(%f) = %f, want %f", c.contracts, got, c.want)
+			}
+		})
+	}
+}
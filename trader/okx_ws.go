@@ -0,0 +1,541 @@
+package trader
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// OKX WebSocket 地址
+const (
+	okxWsPublicURL  = "wss://ws.okx.com:8443/ws/v5/public"
+	okxWsPrivateURL = "wss://ws.okx.com:8443/ws/v5/private"
+
+	wsPingInterval = 25 * time.Second
+	wsReconnectMin = 1 * time.Second
+	wsReconnectMax = 30 * time.Second
+)
+
+// okxPosition 私有频道推送的持仓缓存条目
+type okxPosition struct {
+	Symbol           string
+	Side             string
+	PositionAmt      float64
+	EntryPrice       float64
+	MarkPrice        float64
+	UnrealizedProfit float64
+	Leverage         float64
+	LiquidationPrice float64
+}
+
+// okxWsClient 管理单条 WebSocket 连接（公共或私有），负责订阅重放、心跳与自动重连
+type okxWsClient struct {
+	url        string
+	private    bool
+	apiKey     string
+	secretKey  string
+	passphrase string
+
+	mu            sync.Mutex
+	conn          *websocket.Conn
+	subscriptions map[string]map[string]interface{} // channel key -> 订阅参数
+	handlers      map[string]func(json.RawMessage)  // channel key -> 回调
+
+	// writeMu 单独串行化实际的 conn.WriteJSON/WriteMessage 调用——
+	// gorilla/websocket 要求同一时间只能有一个 goroutine 写连接，
+	// 而 mu 只保护 conn 指针和订阅/回调表，run() 里的心跳 ping 和 subscribe/writeJSON
+	// 可能在不同 goroutine 上并发调用，仅靠 mu 无法避免两次写操作交叠
+	writeMu sync.Mutex
+
+	closeCh chan struct{}
+}
+
+func newOkxWsClient(url string, private bool, apiKey, secretKey, passphrase string) *okxWsClient {
+	return &okxWsClient{
+		url:           url,
+		private:       private,
+		apiKey:        apiKey,
+		secretKey:     secretKey,
+		passphrase:    passphrase,
+		subscriptions: make(map[string]map[string]interface{}),
+		handlers:      make(map[string]func(json.RawMessage)),
+		closeCh:       make(chan struct{}),
+	}
+}
+
+// start 建立连接并启动读写循环，断线后自动重连并重放订阅
+func (w *okxWsClient) start() error {
+	if err := w.connect(); err != nil {
+		return err
+	}
+	go w.run()
+	return nil
+}
+
+func (w *okxWsClient) connect() error {
+	conn, _, err := websocket.DefaultDialer.Dial(w.url, nil)
+	if err != nil {
+		return fmt.Errorf("连接OKX WebSocket失败 (%s): %w", w.url, err)
+	}
+
+	w.mu.Lock()
+	w.conn = conn
+	w.mu.Unlock()
+
+	if w.private {
+		if err := w.login(); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	w.replaySubscriptions()
+	return nil
+}
+
+// login 按照 timestamp + "GET" + "/users/self/verify" 的规则签名登录私有频道
+func (w *okxWsClient) login() error {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	prehash := ts + "GET" + "/users/self/verify"
+
+	mac := hmac.New(sha256.New, []byte(w.secretKey))
+	mac.Write([]byte(prehash))
+	sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req := map[string]interface{}{
+		"op": "login",
+		"args": []map[string]string{
+			{
+				"apiKey":     w.apiKey,
+				"passphrase": w.passphrase,
+				"timestamp":  ts,
+				"sign":       sign,
+			},
+		},
+	}
+
+	return w.writeJSON(req)
+}
+
+func (w *okxWsClient) writeJSON(v interface{}) error {
+	w.mu.Lock()
+	conn := w.conn
+	w.mu.Unlock()
+	if conn == nil {
+		return fmt.Errorf("OKX WebSocket 未连接")
+	}
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	return conn.WriteJSON(v)
+}
+
+// subscribe 记录订阅参数（用于断线重放）并发送订阅请求
+func (w *okxWsClient) subscribe(key string, args map[string]interface{}, handler func(json.RawMessage)) error {
+	w.mu.Lock()
+	w.subscriptions[key] = args
+	w.handlers[key] = handler
+	w.mu.Unlock()
+
+	return w.writeJSON(map[string]interface{}{
+		"op":   "subscribe",
+		"args": []map[string]interface{}{args},
+	})
+}
+
+func (w *okxWsClient) replaySubscriptions() {
+	w.mu.Lock()
+	args := make([]map[string]interface{}, 0, len(w.subscriptions))
+	for _, a := range w.subscriptions {
+		args = append(args, a)
+	}
+	w.mu.Unlock()
+
+	if len(args) == 0 {
+		return
+	}
+	if err := w.writeJSON(map[string]interface{}{"op": "subscribe", "args": args}); err != nil {
+		log.Printf("⚠ OKX WebSocket 重放订阅失败: %v", err)
+	}
+}
+
+// run 是读循环，负责分发推送消息、维持心跳，并在断线时自动重连
+func (w *okxWsClient) run() {
+	pingTicker := time.NewTicker(wsPingInterval)
+	defer pingTicker.Stop()
+
+	msgCh := make(chan []byte, 64)
+	errCh := make(chan error, 1)
+
+	go w.readLoop(msgCh, errCh)
+
+	backoff := wsReconnectMin
+	for {
+		select {
+		case <-w.closeCh:
+			return
+		case <-pingTicker.C:
+			w.mu.Lock()
+			conn := w.conn
+			w.mu.Unlock()
+			if conn != nil {
+				w.writeMu.Lock()
+				_ = conn.WriteMessage(websocket.TextMessage, []byte("ping"))
+				w.writeMu.Unlock()
+			}
+		case msg := <-msgCh:
+			w.dispatch(msg)
+			backoff = wsReconnectMin
+		case err := <-errCh:
+			log.Printf("⚠ OKX WebSocket 连接断开 (%s): %v, %v 后重连", w.url, err, backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+			if backoff > wsReconnectMax {
+				backoff = wsReconnectMax
+			}
+			if cerr := w.connect(); cerr != nil {
+				log.Printf("⚠ OKX WebSocket 重连失败: %v", cerr)
+				// 此时没有 readLoop 在运行，重新投递错误以按退避间隔继续重连
+				errCh <- cerr
+				continue
+			}
+			go w.readLoop(msgCh, errCh)
+		}
+	}
+}
+
+func (w *okxWsClient) readLoop(msgCh chan<- []byte, errCh chan<- error) {
+	w.mu.Lock()
+	conn := w.conn
+	w.mu.Unlock()
+	if conn == nil {
+		return
+	}
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		if string(msg) == "pong" {
+			continue
+		}
+		msgCh <- msg
+	}
+}
+
+func (w *okxWsClient) dispatch(msg []byte) {
+	var env struct {
+		Event string `json:"event"`
+		Arg   struct {
+			Channel string `json:"channel"`
+			InstID  string `json:"instId"`
+		} `json:"arg"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(msg, &env); err != nil {
+		return
+	}
+	if env.Event != "" {
+		return // 订阅确认/错误事件，忽略
+	}
+
+	key := env.Arg.Channel + ":" + env.Arg.InstID
+	w.mu.Lock()
+	handler := w.handlers[key]
+	w.mu.Unlock()
+	if handler != nil {
+		handler(env.Data)
+	}
+}
+
+func (w *okxWsClient) stop() {
+	close(w.closeCh)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn != nil {
+		w.conn.Close()
+	}
+}
+
+// --- 公共频道订阅 ---
+
+// TickerCallback 行情回调，price 为最新成交价
+type TickerCallback func(symbol string, price float64)
+
+// DepthCallback 深度回调，bids/asks 为 [价格, 数量] 列表
+type DepthCallback func(symbol string, bids, asks [][2]float64)
+
+// KlineCallback K线回调
+type KlineCallback func(symbol string, k Kline)
+
+// Kline 表示一根K线
+type Kline struct {
+	Timestamp int64
+	Open      float64
+	High      float64
+	Low       float64
+	Close     float64
+	Volume    float64
+}
+
+// ensurePublicWs 建立一次公共频道连接。成功后后续断线由 okxWsClient.run() 内部的
+// 重连循环接管；若本次建连失败则不缓存错误，下一次调用会重新尝试
+func (t *OkxTrader) ensurePublicWs() error {
+	t.wsPublicMu.Lock()
+	defer t.wsPublicMu.Unlock()
+
+	if t.wsPublic != nil {
+		return nil
+	}
+
+	client := newOkxWsClient(okxWsPublicURL, false, "", "", "")
+	if err := client.start(); err != nil {
+		return err
+	}
+	t.wsPublic = client
+	return nil
+}
+
+// ensurePrivateWs 建立一次私有频道连接，语义同 ensurePublicWs
+func (t *OkxTrader) ensurePrivateWs() error {
+	t.wsPrivateMu.Lock()
+	defer t.wsPrivateMu.Unlock()
+
+	if t.wsPrivate != nil {
+		return nil
+	}
+
+	client := newOkxWsClient(okxWsPrivateURL, true, t.apiKey, t.secretKey, t.passphrase)
+	if err := client.start(); err != nil {
+		return err
+	}
+	t.wsPrivate = client
+	return nil
+}
+
+// SubscribeTicker 订阅实时行情
+func (t *OkxTrader) SubscribeTicker(symbol string, cb TickerCallback) error {
+	if err := t.ensurePublicWs(); err != nil {
+		return err
+	}
+	instID := okxSymbol(symbol)
+	return t.wsPublic.subscribe("tickers:"+instID, map[string]interface{}{
+		"channel": "tickers",
+		"instId":  instID,
+	}, func(data json.RawMessage) {
+		var tickers []struct {
+			Last string `json:"last"`
+		}
+		if err := json.Unmarshal(data, &tickers); err != nil || len(tickers) == 0 {
+			return
+		}
+		cb(symbol, parseFloat(tickers[0].Last))
+	})
+}
+
+// SubscribeDepth 订阅深度数据（books5 档位）
+func (t *OkxTrader) SubscribeDepth(symbol string, cb DepthCallback) error {
+	if err := t.ensurePublicWs(); err != nil {
+		return err
+	}
+	instID := okxSymbol(symbol)
+	return t.wsPublic.subscribe("books5:"+instID, map[string]interface{}{
+		"channel": "books5",
+		"instId":  instID,
+	}, func(data json.RawMessage) {
+		var books []struct {
+			Bids [][]string `json:"bids"`
+			Asks [][]string `json:"asks"`
+		}
+		if err := json.Unmarshal(data, &books); err != nil || len(books) == 0 {
+			return
+		}
+		cb(symbol, parseDepthSide(books[0].Bids), parseDepthSide(books[0].Asks))
+	})
+}
+
+func parseDepthSide(levels [][]string) [][2]float64 {
+	out := make([][2]float64, 0, len(levels))
+	for _, lvl := range levels {
+		if len(lvl) < 2 {
+			continue
+		}
+		out = append(out, [2]float64{parseFloat(lvl[0]), parseFloat(lvl[1])})
+	}
+	return out
+}
+
+// SubscribeKline 订阅K线推送，interval 如 "1m"/"5m"
+func (t *OkxTrader) SubscribeKline(symbol, interval string, cb KlineCallback) error {
+	if err := t.ensurePublicWs(); err != nil {
+		return err
+	}
+	instID := okxSymbol(symbol)
+	channel := "candle" + interval
+	return t.wsPublic.subscribe(channel+":"+instID, map[string]interface{}{
+		"channel": channel,
+		"instId":  instID,
+	}, func(data json.RawMessage) {
+		var rows [][]string
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return
+		}
+		for _, row := range rows {
+			if len(row) < 6 {
+				continue
+			}
+			ts, _ := strconv.ParseInt(row[0], 10, 64)
+			cb(symbol, Kline{
+				Timestamp: ts,
+				Open:      parseFloat(row[1]),
+				High:      parseFloat(row[2]),
+				Low:       parseFloat(row[3]),
+				Close:     parseFloat(row[4]),
+				Volume:    parseFloat(row[5]),
+			})
+		}
+	})
+}
+
+// --- 私有频道订阅 ---
+
+// PositionsCallback 持仓推送回调
+type PositionsCallback func(positions []map[string]interface{})
+
+// OrdersCallback 订单推送回调
+type OrdersCallback func(order map[string]interface{})
+
+// BalanceCallback 余额推送回调
+type BalanceCallback func(balance map[string]interface{})
+
+// SubscribePositions 订阅持仓更新，推送同时写入本地持仓缓存
+func (t *OkxTrader) SubscribePositions(cb PositionsCallback) error {
+	if err := t.ensurePrivateWs(); err != nil {
+		return err
+	}
+	return t.wsPrivate.subscribe("positions:", map[string]interface{}{
+		"channel":  "positions",
+		"instType": "SWAP",
+	}, func(data json.RawMessage) {
+		var rows []struct {
+			InstID  string `json:"instId"`
+			PosSide string `json:"posSide"`
+			Pos     string `json:"pos"`
+			AvgPx   string `json:"avgPx"`
+			MarkPx  string `json:"markPx"`
+			Upl     string `json:"upl"`
+			Lever   string `json:"lever"`
+			LiqPx   string `json:"liqPx"`
+		}
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return
+		}
+
+		var out []map[string]interface{}
+		for _, r := range rows {
+			symbol := standardSymbol(r.InstID)
+
+			// r.Pos 是以"张"计价的合约数量，换算为标的币种数量，与REST GetPositions保持一致
+			posAmt, err := t.ContractsToCoin(r.InstID, parseFloat(r.Pos))
+			if err != nil {
+				log.Printf("⚠ %s 合约张数转换失败，使用原始张数: %v", r.InstID, err)
+				posAmt = parseFloat(r.Pos)
+			}
+
+			// 单向持仓下OKX的posSide恒为"net"，按持仓数量正负号归一化为 long/short，
+			// 使缓存键与 CloseLong/CloseShort 的查找方式保持一致
+			side := normalizePosSide(t.accountMode, r.PosSide, posAmt)
+
+			t.positionCache.Store(symbol+":"+side, okxPosition{
+				Symbol:           symbol,
+				Side:             side,
+				PositionAmt:      posAmt,
+				EntryPrice:       parseFloat(r.AvgPx),
+				MarkPrice:        parseFloat(r.MarkPx),
+				UnrealizedProfit: parseFloat(r.Upl),
+				Leverage:         parseFloat(r.Lever),
+				LiquidationPrice: parseFloat(r.LiqPx),
+			})
+
+			if posAmt == 0 {
+				continue
+			}
+			out = append(out, map[string]interface{}{
+				"symbol":           symbol,
+				"side":             side,
+				"positionAmt":      posAmt,
+				"entryPrice":       parseFloat(r.AvgPx),
+				"markPrice":        parseFloat(r.MarkPx),
+				"unRealizedProfit": parseFloat(r.Upl),
+				"leverage":         parseFloat(r.Lever),
+				"liquidationPrice": parseFloat(r.LiqPx),
+			})
+		}
+		if cb != nil {
+			cb(out)
+		}
+	})
+}
+
+// SubscribeOrders 订阅订单状态更新
+func (t *OkxTrader) SubscribeOrders(cb OrdersCallback) error {
+	if err := t.ensurePrivateWs(); err != nil {
+		return err
+	}
+	return t.wsPrivate.subscribe("orders:", map[string]interface{}{
+		"channel":  "orders",
+		"instType": "SWAP",
+	}, func(data json.RawMessage) {
+		var rows []map[string]interface{}
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return
+		}
+		for _, r := range rows {
+			cb(r)
+		}
+	})
+}
+
+// SubscribeBalance 订阅账户余额更新
+func (t *OkxTrader) SubscribeBalance(cb BalanceCallback) error {
+	if err := t.ensurePrivateWs(); err != nil {
+		return err
+	}
+	return t.wsPrivate.subscribe("account:", map[string]interface{}{
+		"channel": "account",
+	}, func(data json.RawMessage) {
+		var rows []struct {
+			TotalEq string `json:"totalEq"`
+			Upl     string `json:"upl"`
+			AvailEq string `json:"availEq"`
+		}
+		if err := json.Unmarshal(data, &rows); err != nil || len(rows) == 0 {
+			return
+		}
+		r := rows[0]
+		totalEq := parseFloat(r.TotalEq)
+		upl := parseFloat(r.Upl)
+		cb(map[string]interface{}{
+			"totalWalletBalance":    totalEq - upl,
+			"availableBalance":      parseFloat(r.AvailEq),
+			"totalUnrealizedProfit": upl,
+		})
+	})
+}
+
+// cachedPosition 从本地持仓缓存读取仓位，避免 CloseLong/CloseShort 里昂贵的 REST 往返
+func (t *OkxTrader) cachedPosition(symbol, posSide string) (okxPosition, bool) {
+	val, ok := t.positionCache.Load(symbol + ":" + posSide)
+	if !ok {
+		return okxPosition{}, false
+	}
+	return val.(okxPosition), true
+}